@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/trace"
+)
+
+// AdminServerConfig configures the operator-only HTTP admin listener.
+// Bind it to a private address — it is not meant to be internet-facing.
+type AdminServerConfig struct {
+	Addr string
+}
+
+// NewAdminServer builds the admin HTTP mux: policy reload, Prometheus
+// metrics, x/net/trace's request/event viewers, and a cache dump — all
+// operator-only, so this should never be bound to a public address.
+func NewAdminServer(cfg AdminServerConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reload", handleAdminReload)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/debug/requests", trace.Traces)
+	mux.HandleFunc("/debug/events", trace.Events)
+	mux.HandleFunc("/debug/cache", handleAdminCacheDump)
+	return &http.Server{Addr: cfg.Addr, Handler: mux}
+}
+
+// handleAdminCacheDump dumps the current contents of the response cache
+// (key, rcode, remaining TTL, answer count) for troubleshooting. Only
+// supported against the memory backend; Redis has no cheap way to
+// enumerate keys it doesn't already own exclusively.
+func handleAdminCacheDump(w http.ResponseWriter, req *http.Request) {
+	mc, ok := cache.(*MemoryCache)
+	if !ok {
+		http.Error(w, "cache dump not supported for the configured backend", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, entry := range mc.Dump() {
+		fmt.Fprintf(w, "%s\trcode=%s\tttl=%s\tanswers=%d\n",
+			entry.Key, dns.RcodeToString[entry.Rcode], entry.RemainingTTL.Round(time.Second), entry.AnswerCount)
+	}
+}
+
+// handleAdminReload refreshes the policy engine's rule sets from disk
+// without restarting the process.
+func handleAdminReload(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := policyEngine.Reload(); err != nil {
+		log.Printf("admin: policy reload failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("admin: policy reload succeeded")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// watchReloadSignal reloads the policy engine whenever the process
+// receives SIGHUP, so blocklists can be refreshed without a restart.
+func watchReloadSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		for range sigCh {
+			log.Println("received SIGHUP, reloading policy engine")
+			if err := policyEngine.Reload(); err != nil {
+				log.Printf("policy reload failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Cache abstracts the response cache backend used by handleDNS, so the
+// forwarder can run against a local in-memory cache or a shared store
+// (e.g. Redis) without changing any caller code.
+type Cache interface {
+	// Get returns a copy of the cached response for key, or false on a
+	// miss or expired entry.
+	Get(key string) (*dns.Msg, bool)
+	// Set stores msg under key for ttl.
+	Set(key string, msg *dns.Msg, ttl time.Duration)
+	// Delete removes key from the cache, if present.
+	Delete(key string)
+}
+
+// CacheConfig selects and tunes the response cache backend.
+type CacheConfig struct {
+	// Backend is "memory" or "redis". Defaults to "memory".
+	Backend string
+
+	// MaxEntries bounds the number of distinct (qname, qtype) answers kept
+	// in memory. Only consulted by the memory backend.
+	MaxEntries int
+	// MaxNegativeTTL caps how long NXDOMAIN/NODATA answers are cached,
+	// regardless of what the SOA MINIMUM advertises (RFC 2308 §5).
+	MaxNegativeTTL time.Duration
+
+	// RedisURL is a redis:// or rediss:// connection URL, used only by
+	// the redis backend. It may also be supplied via the REDIS_URL env
+	// var.
+	RedisURL string
+	// RedisKeyPrefix namespaces keys so multiple services can share a
+	// Redis instance.
+	RedisKeyPrefix string
+}
+
+// DefaultCacheConfig is the configuration used when none is supplied: an
+// in-memory LRU of 10000 entries with negative answers capped at 5 minutes.
+var DefaultCacheConfig = CacheConfig{
+	Backend:        "memory",
+	MaxEntries:     10000,
+	MaxNegativeTTL: 5 * time.Minute,
+	RedisKeyPrefix: "mine-dns:",
+}
+
+// NewCache builds the Cache backend selected by cfg.Backend.
+func NewCache(cfg CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryCache(cfg), nil
+	case "redis":
+		return NewRedisCache(cfg)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// computeCacheTTL derives how long resp should be cached for. Positive
+// answers use the minimum TTL across the Answer, Ns, and Extra sections
+// (RFC 2181 §5.2) rather than just the first Answer record. Negative
+// answers (NXDOMAIN/NODATA) use the lesser of the SOA record's own TTL and
+// its MINIMUM field from the Authority section (RFC 2308), capped at
+// maxNegativeTTL.
+func computeCacheTTL(resp *dns.Msg, maxNegativeTTL time.Duration) time.Duration {
+	if len(resp.Answer) > 0 {
+		return minRecordTTL(resp)
+	}
+
+	if soa := findSOA(resp.Ns); soa != nil {
+		negTTL := soa.Minttl
+		if soa.Hdr.Ttl < negTTL {
+			negTTL = soa.Hdr.Ttl
+		}
+		ttl := time.Duration(negTTL) * time.Second
+		if ttl > maxNegativeTTL {
+			ttl = maxNegativeTTL
+		}
+		return ttl
+	}
+
+	// No SOA to derive a negative TTL from (e.g. SERVFAIL, or an upstream
+	// that omits it) — fall back to a short, conservative TTL.
+	if resp.Rcode == dns.RcodeNameError {
+		return 60 * time.Second
+	}
+	return 30 * time.Second
+}
+
+// minRecordTTL returns the smallest TTL across every record in the
+// Answer, Ns, and Extra sections, skipping the pseudo-TTL carried by an
+// OPT (EDNS0) record.
+func minRecordTTL(resp *dns.Msg) time.Duration {
+	min := uint32(0)
+	seen := false
+
+	consider := func(rrs []dns.RR) {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			ttl := rr.Header().Ttl
+			if !seen || ttl < min {
+				min = ttl
+				seen = true
+			}
+		}
+	}
+
+	consider(resp.Answer)
+	consider(resp.Ns)
+	consider(resp.Extra)
+
+	if !seen {
+		return 30 * time.Second
+	}
+	return time.Duration(min) * time.Second
+}
+
+// findSOA returns the first SOA record in rrs, or nil.
+func findSOA(rrs []dns.RR) *dns.SOA {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa
+		}
+	}
+	return nil
+}
+
+// applyTTL overwrites the TTL of every non-OPT record in msg's Answer, Ns,
+// and Extra sections with ttl, so callers see accurate remaining lifetime
+// rather than the TTL the entry was originally stored with.
+func applyTTL(msg *dns.Msg, ttl uint32) {
+	rewrite := func(rrs []dns.RR) {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			rr.Header().Ttl = ttl
+		}
+	}
+	rewrite(msg.Answer)
+	rewrite(msg.Ns)
+	rewrite(msg.Extra)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// maxDoHBodySize bounds a POST request body; a DNS message over UDP/TCP is
+// capped at 65535 bytes, so anything larger is malformed or abusive.
+const maxDoHBodySize = 65535
+
+// DoHServerConfig configures the RFC 8484 DNS-over-HTTPS listener that lets
+// mine-dns itself serve DoH, in addition to forwarding to one.
+type DoHServerConfig struct {
+	Addr     string
+	CertFile string
+	KeyFile  string
+	// Insecure serves plain HTTP (with h2c for HTTP/2) instead of TLS,
+	// for deployments fronted by a TLS-terminating reverse proxy.
+	Insecure bool
+}
+
+// NewDoHServer builds the *http.Server for the DoH endpoint per cfg.
+func NewDoHServer(cfg DoHServerConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dns-query", handleDoHQuery)
+
+	var handler http.Handler = mux
+	if cfg.Insecure {
+		// No TLS means no ALPN negotiation, so serve h2c (HTTP/2 over
+		// cleartext) for clients/front-proxies that speak it directly.
+		handler = h2c.NewHandler(mux, &http2.Server{})
+	}
+
+	return &http.Server{Addr: cfg.Addr, Handler: handler}
+}
+
+// ListenAndServeDoH starts the DoH listener per cfg, blocking until it
+// exits or fails.
+func ListenAndServeDoH(cfg DoHServerConfig) error {
+	server := NewDoHServer(cfg)
+
+	if cfg.Insecure {
+		return server.ListenAndServe()
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return errors.New("doh server: CertFile and KeyFile are required unless Insecure is set")
+	}
+	if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+		return fmt.Errorf("doh server: configure http2: %w", err)
+	}
+	return server.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+}
+
+// handleDoHQuery implements RFC 8484 §4.1/§4.2: a GET with a base64url
+// "dns" query parameter or a POST with an application/dns-message body,
+// both carrying a wire-format DNS query.
+func handleDoHQuery(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := decodeDoHRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := new(dns.Msg)
+	if err := query.Unpack(raw); err != nil {
+		http.Error(w, "malformed dns message", http.StatusBadRequest)
+		return
+	}
+	if len(query.Question) == 0 {
+		http.Error(w, "dns message has no question", http.StatusBadRequest)
+		return
+	}
+
+	resp, ttl, err := resolveWithCache(req.Context(), query)
+	if err != nil {
+		log.Printf("doh: resolve error for %s: %v", query.Question[0].Name, err)
+		http.Error(w, "resolution failed", http.StatusBadGateway)
+		return
+	}
+	recordQuery(query.Question[0].Qtype, resp.Rcode)
+
+	packed, err := resp.Pack()
+	if err != nil {
+		http.Error(w, "failed to encode dns response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/dns-message")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(ttl.Seconds())))
+	w.Write(packed)
+}
+
+// decodeDoHRequest extracts the raw wire-format DNS query from a GET or
+// POST DoH request per RFC 8484.
+func decodeDoHRequest(req *http.Request) ([]byte, error) {
+	switch req.Method {
+	case http.MethodGet:
+		encoded := req.URL.Query().Get("dns")
+		if encoded == "" {
+			return nil, errors.New("missing dns query parameter")
+		}
+		if len(encoded) > base64.RawURLEncoding.EncodedLen(maxDoHBodySize) {
+			return nil, errors.New("dns query parameter too large")
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("malformed dns query parameter")
+		}
+		return raw, nil
+
+	case http.MethodPost:
+		if ct := req.Header.Get("Content-Type"); ct != "application/dns-message" {
+			return nil, errors.New("unsupported content-type, want application/dns-message")
+		}
+		raw, err := io.ReadAll(io.LimitReader(req.Body, maxDoHBodySize+1))
+		if err != nil {
+			return nil, errors.New("failed to read request body")
+		}
+		if len(raw) > maxDoHBodySize {
+			return nil, errors.New("request body too large")
+		}
+		return raw, nil
+
+	default:
+		return nil, errors.New("method not allowed")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import "github.com/miekg/dns"
+
+// defaultUDPSize is what RFC 1035 §4.2.1 guarantees is safe when a
+// requester sends no EDNS0 OPT record at all.
+const defaultUDPSize = uint16(dns.MinMsgSize)
+
+// forwardUDPSize is the buffer size we advertise to upstreams on the
+// query's behalf when the original requester didn't send an OPT record,
+// so plain UDP/TCP upstreams aren't forced down to the 512-byte default.
+const forwardUDPSize = uint16(4096)
+
+// clientUDPSize returns the UDP payload size the requester advertised via
+// EDNS0, or the conservative default (512) if it sent no OPT record, or
+// advertised an implausibly small one.
+func clientUDPSize(r *dns.Msg) uint16 {
+	if opt := r.IsEdns0(); opt != nil {
+		if sz := opt.UDPSize(); sz >= dns.MinMsgSize {
+			return sz
+		}
+	}
+	return defaultUDPSize
+}
+
+// ensureForwardEDNS0 makes sure the query handed to the upstream resolver
+// carries an OPT record, so upstreams (notably plain UDP/TCP ones, but
+// also DoH upstreams that key their answer size on it) size their answer
+// for a reasonable buffer even when the original requester didn't
+// advertise EDNS0 support.
+func ensureForwardEDNS0(query *dns.Msg) {
+	if query.IsEdns0() != nil {
+		return
+	}
+	query.SetEdns0(forwardUDPSize, false)
+}
+
+// rewriteResponseEDNS0 replaces whatever OPT record resp came back with
+// (from cache or from an upstream) with one reflecting what the requester
+// actually advertised: stripped entirely if the requester sent no EDNS0
+// at all, otherwise rewritten to the requester's own UDP size. This keeps
+// an upstream's negotiated buffer size or options from leaking back to a
+// client that never asked for them.
+func rewriteResponseEDNS0(resp *dns.Msg, requesterOpt *dns.OPT) {
+	resp.Extra = stripOPT(resp.Extra)
+	if requesterOpt == nil {
+		return
+	}
+
+	opt := new(dns.OPT)
+	opt.Hdr.Name = "."
+	opt.Hdr.Rrtype = dns.TypeOPT
+	opt.SetUDPSize(requesterOpt.UDPSize())
+	resp.Extra = append(resp.Extra, opt)
+}
+
+// stripOPT returns rrs with any OPT pseudo-record removed.
+func stripOPT(rrs []dns.RR) []dns.RR {
+	out := rrs[:0]
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+// truncateForUDP enforces maxSize over UDP per RFC 1035 §4.2.1: if the
+// packed response would exceed it, the answer/authority/additional
+// sections are dropped (keeping only the OPT record, if any) and TC is
+// set so the client retries over TCP.
+func truncateForUDP(resp *dns.Msg, maxSize uint16) {
+	packed, err := resp.Pack()
+	if err == nil && len(packed) <= int(maxSize) {
+		return
+	}
+
+	opt := resp.IsEdns0()
+	resp.Truncated = true
+	resp.Answer = nil
+	resp.Ns = nil
+	if opt != nil {
+		resp.Extra = []dns.RR{opt}
+	} else {
+		resp.Extra = nil
+	}
+}
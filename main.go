@@ -1,124 +1,175 @@
 package main
 
 import (
-	"encoding/base64"
-	"io"
+	"context"
 	"log"
-	"net/http"
-	"sync"
+	"net"
 	"time"
 
 	"github.com/miekg/dns"
-	"golang.org/x/net/proxy"
+	"golang.org/x/net/trace"
 )
 
-var cache = struct {
-	sync.RWMutex
-	data map[string]cacheEntry
-}{
-	data: make(map[string]cacheEntry),
-}
+var cacheConfig = DefaultCacheConfig
 
-type cacheEntry struct {
-	msg      *dns.Msg
-	expireAt time.Time
-}
+var cache Cache = func() Cache {
+	c, err := NewCache(cacheConfig)
+	if err != nil {
+		log.Fatalf("build cache: %v", err)
+	}
+	return c
+}()
 
 const (
 	dohURL      = "https://cloudflare-dns.com/dns-query"
 	socksServer = "127.0.0.1:10808"
 )
 
+// resolver is the composed Resolver used for every cache miss. It currently
+// wraps a single Cloudflare DoH-GET upstream behind the SOCKS5 proxy, but
+// resolveWithCache no longer knows (or cares) how many upstreams there are
+// or which strategy combines them.
+var resolver Resolver = func() Resolver {
+	dial, err := socks5Dialer(socksServer)
+	if err != nil {
+		log.Fatalf("build socks5 dialer: %v", err)
+	}
+	upstream := NewUpstream(NewDoHGetResolver(dohURL, dial), 1)
+	return NewMultiResolver(StrategyFailover, upstream)
+}()
+
+// dohServerConfig configures the DoH listener mine-dns itself serves. It
+// runs without TLS by default, for deployments fronted by a reverse proxy
+// that terminates TLS; set CertFile/KeyFile and Insecure=false to serve
+// TLS directly.
+var dohServerConfig = DoHServerConfig{
+	Addr:     ":8443",
+	Insecure: true,
+}
+
+// adminServerConfig configures the operator-only admin listener (policy
+// reload, metrics, traces, and the cache dump). Defaults to loopback-only
+// since it isn't meant to be internet-facing.
+var adminServerConfig = AdminServerConfig{
+	Addr: "127.0.0.1:8080",
+}
+
+// policyEngine blocks, rewrites, or forces NXDOMAIN for queries before
+// they reach the cache or an upstream resolver. No sources are configured
+// by default, so it blocks nothing until LoadConfig is called.
+var policyEngine = NewPolicyEngine()
+
 func main() {
 	dns.HandleFunc(".", handleDNS)
 
-	server := &dns.Server{
+	udpServer := &dns.Server{
 		Addr: ":53",
 		Net:  "udp",
 	}
 
-	log.Println("DNS server started on :53")
-	log.Fatal(server.ListenAndServe())
+	tcpServer := &dns.Server{
+		Addr: ":53",
+		Net:  "tcp",
+	}
+
+	go func() {
+		log.Println("DNS server (TCP) started on :53")
+		if err := tcpServer.ListenAndServe(); err != nil {
+			log.Printf("TCP DNS server error: %v", err)
+		}
+	}()
+
+	go func() {
+		log.Printf("DoH server started on %s (insecure=%v)", dohServerConfig.Addr, dohServerConfig.Insecure)
+		if err := ListenAndServeDoH(dohServerConfig); err != nil {
+			log.Printf("DoH server error: %v", err)
+		}
+	}()
+
+	adminServer := NewAdminServer(adminServerConfig)
+	go func() {
+		log.Printf("Admin server started on %s", adminServerConfig.Addr)
+		if err := adminServer.ListenAndServe(); err != nil {
+			log.Printf("Admin server error: %v", err)
+		}
+	}()
+
+	watchReloadSignal()
+
+	log.Println("DNS server (UDP) started on :53")
+	log.Fatal(udpServer.ListenAndServe())
 }
 
 func handleDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) == 0 {
+		log.Printf("dropping query with no question section from %s", w.RemoteAddr())
+		return
+	}
 	q := r.Question[0]
 	log.Printf("Received query: %s %s from %s", q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr())
 
-	cacheKey := q.Name + ":" + dns.TypeToString[q.Qtype]
-
-	// Check cache
-	cache.RLock()
-	entry, found := cache.data[cacheKey]
-	cache.RUnlock()
+	requesterOpt := r.IsEdns0()
+	maxSize := clientUDPSize(r)
 
-	if found && time.Now().Before(entry.expireAt) {
-		log.Printf("Cache HIT for %s", cacheKey)
-		entryPrim := entry.msg.Copy()
-		entryPrim.Id = r.Id
-		w.WriteMsg(entryPrim)
-		return
-	}
-	log.Printf("Cache MISS for %s, querying DoH upstream", cacheKey)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// Cache miss → resolve via DoH
-	resp, err := resolveDoH(r)
+	resp, _, err := resolveWithCache(ctx, r)
 	if err != nil {
-		log.Printf("DoH resolve error for %s: %v", cacheKey, err)
+		log.Printf("resolve error for %s: %v", q.Name, err)
 		return
 	}
 
-	var ttl time.Duration
-	if len(resp.Answer) > 0 {
-		ttl = time.Duration(resp.Answer[0].Header().Ttl) * time.Second
-	} else if resp.Rcode == dns.RcodeNameError {
-		ttl = 60 * time.Second
-	} else {
-		ttl = 30 * time.Second
-	}
+	recordQuery(q.Qtype, resp.Rcode)
+	rewriteResponseEDNS0(resp, requesterOpt)
 
-	cache.Lock()
-	cache.data[cacheKey] = cacheEntry{
-		msg:      resp,
-		expireAt: time.Now().Add(ttl),
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+		truncateForUDP(resp, maxSize)
 	}
-	cache.Unlock()
-	log.Printf("Stored %s in cache with TTL %s", cacheKey, ttl)
 
 	w.WriteMsg(resp)
 }
 
-func resolveDoH(query *dns.Msg) (*dns.Msg, error) {
-	raw, _ := query.Pack()
-	encoded := base64.RawURLEncoding.EncodeToString(raw)
+// resolveWithCache applies the policy engine, then answers r from the
+// cache if possible, otherwise resolves it against the upstream resolver
+// and stores the result, returning the response along with the TTL it
+// should be considered valid for. It is the shared query path behind both
+// the UDP/TCP listeners and the DoH server.
+func resolveWithCache(ctx context.Context, r *dns.Msg) (*dns.Msg, time.Duration, error) {
+	q := r.Question[0]
+	cacheKey := q.Name + ":" + dns.TypeToString[q.Qtype]
 
-	req, _ := http.NewRequest("GET", dohURL+"?dns="+encoded, nil)
-	req.Header.Set("Accept", "application/dns-message")
+	tr := trace.New("dns.query", q.Name)
+	defer tr.Finish()
 
-	// SOCKS5 Dialer
-	dialer, err := proxy.SOCKS5("tcp", socksServer, nil, proxy.Direct)
-	if err != nil {
-		return nil, err
+	if resp, blocked := policyEngine.Apply(r); blocked {
+		tr.LazyPrintf("blocked by policy engine")
+		return resp, PolicyTTL * time.Second, nil
 	}
 
-	transport := &http.Transport{}
-	transport.Dial = dialer.Dial
-
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   10 * time.Second,
+	if cached, found := cache.Get(cacheKey); found {
+		tr.LazyPrintf("cache hit for %s", cacheKey)
+		cacheHitsTotal.Inc()
+		log.Printf("Cache HIT for %s", cacheKey)
+		cached.Id = r.Id
+		return cached, minRecordTTL(cached), nil
 	}
+	tr.LazyPrintf("cache miss for %s", cacheKey)
+	cacheMissesTotal.Inc()
+	log.Printf("Cache MISS for %s, querying upstream resolver", cacheKey)
 
-	resp, err := client.Do(req)
+	ensureForwardEDNS0(r)
+	resp, err := resolver.Resolve(ctx, r)
 	if err != nil {
-		return nil, err
+		tr.LazyPrintf("upstream resolve failed: %v", err)
+		tr.SetError()
+		return nil, 0, err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
+	tr.LazyPrintf("resolved via upstream")
 
-	dnsResp := new(dns.Msg)
-	dnsResp.Unpack(body)
+	ttl := computeCacheTTL(resp, cacheConfig.MaxNegativeTTL)
+	cache.Set(cacheKey, resp, ttl)
+	log.Printf("Stored %s in cache with TTL %s", cacheKey, ttl)
 
-	return dnsResp, nil
+	return resp, ttl, nil
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/miekg/dns"
+)
+
+// memoryCacheEntry is what the LRU actually stores. ttl is the TTL the
+// entry was stored with; remaining lifetime is derived from storedAt on
+// every read rather than mutating the message in place.
+type memoryCacheEntry struct {
+	msg      *dns.Msg
+	storedAt time.Time
+	ttl      time.Duration
+}
+
+// MemoryCache is a bounded, in-process LRU cache of DNS responses keyed by
+// "<qname>:<qtype>". Entries are evicted by recency once MaxEntries is
+// reached, and expired entries are evicted lazily on read.
+type MemoryCache struct {
+	mu  sync.Mutex
+	lru *lru.Cache[string, *memoryCacheEntry]
+}
+
+// NewMemoryCache builds a MemoryCache from cfg.
+func NewMemoryCache(cfg CacheConfig) *MemoryCache {
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheConfig.MaxEntries
+	}
+
+	l, err := lru.NewWithEvict[string, *memoryCacheEntry](maxEntries, func(string, *memoryCacheEntry) {
+		cacheEvictionsTotal.Inc()
+	})
+	if err != nil {
+		// Only returns an error for a non-positive size, which we've
+		// already normalized above.
+		panic(err)
+	}
+
+	return &MemoryCache{lru: l}
+}
+
+func (c *MemoryCache) Get(key string) (*dns.Msg, bool) {
+	c.mu.Lock()
+	entry, found := c.lru.Get(key)
+	c.mu.Unlock()
+
+	if !found {
+		return nil, false
+	}
+
+	remaining := entry.ttl - time.Since(entry.storedAt)
+	if remaining <= 0 {
+		c.mu.Lock()
+		c.lru.Remove(key)
+		cacheEntries.Set(float64(c.lru.Len()))
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	msg := entry.msg.Copy()
+	applyTTL(msg, uint32(remaining.Seconds()))
+	return msg, true
+}
+
+func (c *MemoryCache) Set(key string, msg *dns.Msg, ttl time.Duration) {
+	c.mu.Lock()
+	c.lru.Add(key, &memoryCacheEntry{
+		// Copy defensively: callers (notably resolveWithCache) hand us
+		// the same *dns.Msg they return up the stack, and handleDNS
+		// mutates that response in place (EDNS0 rewriting, UDP
+		// truncation) after it's been cached. Storing the live pointer
+		// would let those in-place mutations poison the cached entry
+		// for every other client.
+		msg:      msg.Copy(),
+		storedAt: time.Now(),
+		ttl:      ttl,
+	})
+	cacheEntries.Set(float64(c.lru.Len()))
+	c.mu.Unlock()
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	c.lru.Remove(key)
+	cacheEntries.Set(float64(c.lru.Len()))
+	c.mu.Unlock()
+}
+
+// CacheDumpEntry is a single row of a MemoryCache.Dump() snapshot.
+type CacheDumpEntry struct {
+	Key          string
+	Rcode        int
+	RemainingTTL time.Duration
+	AnswerCount  int
+}
+
+// Dump returns a snapshot of every live entry, for the /debug/cache admin
+// endpoint. Expired entries are skipped but not evicted.
+func (c *MemoryCache) Dump() []CacheDumpEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := c.lru.Keys()
+	out := make([]CacheDumpEntry, 0, len(keys))
+	for _, key := range keys {
+		entry, ok := c.lru.Peek(key)
+		if !ok {
+			continue
+		}
+		remaining := entry.ttl - time.Since(entry.storedAt)
+		if remaining <= 0 {
+			continue
+		}
+		out = append(out, CacheDumpEntry{
+			Key:          key,
+			Rcode:        entry.msg.Rcode,
+			RemainingTTL: remaining,
+			AnswerCount:  len(entry.msg.Answer),
+		})
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mine_dns_queries_total",
+		Help: "Total DNS queries handled, by query type and response code.",
+	}, []string{"qtype", "rcode"})
+
+	cacheHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mine_dns_cache_hits_total",
+		Help: "Total response cache hits.",
+	})
+
+	cacheMissesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mine_dns_cache_misses_total",
+		Help: "Total response cache misses.",
+	})
+
+	cacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mine_dns_cache_evictions_total",
+		Help: "Total response cache evictions, by LRU capacity or expiry.",
+	})
+
+	cacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "mine_dns_cache_entries",
+		Help: "Current number of entries in the response cache.",
+	})
+
+	upstreamLatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mine_dns_upstream_latency_seconds",
+		Help:    "Latency of upstream resolver queries, by upstream.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream"})
+
+	policyBlocksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mine_dns_policy_blocks_total",
+		Help: "Total queries blocked/rewritten by the policy engine, by rule source.",
+	}, []string{"source"})
+)
+
+// recordQuery counts a handled query by type and response code.
+func recordQuery(qtype uint16, rcode int) {
+	queriesTotal.WithLabelValues(dns.TypeToString[qtype], strconv.Itoa(rcode)).Inc()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Strategy selects how a MultiResolver distributes queries across its
+// configured upstreams.
+type Strategy int
+
+const (
+	// StrategyFailover tries upstreams in order, skipping those whose
+	// circuit breaker is currently open, and falls through to the next
+	// one on error or SERVFAIL.
+	StrategyFailover Strategy = iota
+	// StrategyRace fires the query at every upstream in parallel and
+	// returns the first successful answer, cancelling the rest.
+	StrategyRace
+	// StrategyWeightedRoundRobin cycles through upstreams proportionally
+	// to their configured weight.
+	StrategyWeightedRoundRobin
+)
+
+// These constants tune how quickly an upstream's circuit breaker considers
+// it unhealthy and how long it stays skipped.
+const (
+	breakerFailureThreshold = 3
+	breakerCooldown         = 30 * time.Second
+)
+
+// circuitBreaker tracks consecutive failures for a single upstream and
+// temporarily takes it out of rotation once it trips.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func (b *circuitBreaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.openUntil)
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= breakerFailureThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// Upstream pairs a Resolver with a weight used by StrategyWeightedRoundRobin
+// and a circuit breaker used by StrategyFailover.
+type Upstream struct {
+	Resolver Resolver
+	Weight   int
+
+	breaker circuitBreaker
+}
+
+// NewUpstream wraps a resolver for use with MultiResolver. weight is only
+// consulted under StrategyWeightedRoundRobin and must be >= 1.
+func NewUpstream(resolver Resolver, weight int) *Upstream {
+	if weight < 1 {
+		weight = 1
+	}
+	return &Upstream{Resolver: resolver, Weight: weight}
+}
+
+// MultiResolver composes several upstreams behind a single Resolver,
+// distributing queries according to its Strategy.
+type MultiResolver struct {
+	strategy  Strategy
+	upstreams []*Upstream
+
+	rrCounter uint64 // StrategyWeightedRoundRobin cursor
+}
+
+// NewMultiResolver builds a composed resolver over upstreams using strategy.
+func NewMultiResolver(strategy Strategy, upstreams ...*Upstream) *MultiResolver {
+	return &MultiResolver{strategy: strategy, upstreams: upstreams}
+}
+
+func (m *MultiResolver) String() string { return "multi-resolver" }
+
+// timedResolve runs up's Resolve and records it against the
+// mine_dns_upstream_latency_seconds histogram, labelled by upstream.
+func timedResolve(ctx context.Context, up *Upstream, query *dns.Msg) (*dns.Msg, error) {
+	start := time.Now()
+	resp, err := up.Resolver.Resolve(ctx, query)
+	upstreamLatencySeconds.WithLabelValues(up.Resolver.String()).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+func (m *MultiResolver) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	if len(m.upstreams) == 0 {
+		return nil, errors.New("multi-resolver: no upstreams configured")
+	}
+
+	switch m.strategy {
+	case StrategyRace:
+		return m.resolveRace(ctx, query)
+	case StrategyWeightedRoundRobin:
+		return m.resolveWeightedRoundRobin(ctx, query)
+	default:
+		return m.resolveFailover(ctx, query)
+	}
+}
+
+func (m *MultiResolver) resolveFailover(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for _, up := range m.upstreams {
+		if up.breaker.open() {
+			log.Printf("multi-resolver: skipping %s, circuit open", up.Resolver)
+			continue
+		}
+
+		resp, err := timedResolve(ctx, up, query)
+		if err != nil {
+			up.breaker.recordFailure()
+			lastErr = err
+			log.Printf("multi-resolver: %s failed: %v", up.Resolver, err)
+			continue
+		}
+		if resp.Rcode == dns.RcodeServerFailure {
+			up.breaker.recordFailure()
+			lastErr = errServerFailure
+			log.Printf("multi-resolver: %s returned SERVFAIL", up.Resolver)
+			continue
+		}
+
+		up.breaker.recordSuccess()
+		return resp, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("multi-resolver: all upstreams circuit-open")
+	}
+	return nil, lastErr
+}
+
+var errServerFailure = errors.New("upstream returned SERVFAIL")
+
+func (m *MultiResolver) resolveRace(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp *dns.Msg
+		err  error
+		up   *Upstream
+	}
+
+	results := make(chan result, len(m.upstreams))
+	for _, up := range m.upstreams {
+		up := up
+		go func() {
+			resp, err := timedResolve(ctx, up, query)
+			results <- result{resp: resp, err: err, up: up}
+		}()
+	}
+
+	var lastErr error
+	for i := 0; i < len(m.upstreams); i++ {
+		res := <-results
+		if res.err != nil {
+			res.up.breaker.recordFailure()
+			lastErr = res.err
+			continue
+		}
+		if res.resp.Rcode == dns.RcodeServerFailure {
+			res.up.breaker.recordFailure()
+			lastErr = errServerFailure
+			continue
+		}
+		res.up.breaker.recordSuccess()
+		return res.resp, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("multi-resolver: race yielded no upstreams")
+	}
+	return nil, lastErr
+}
+
+func (m *MultiResolver) resolveWeightedRoundRobin(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	up := m.pickWeighted()
+	resp, err := timedResolve(ctx, up, query)
+	if err != nil {
+		up.breaker.recordFailure()
+		return nil, err
+	}
+	up.breaker.recordSuccess()
+	return resp, nil
+}
+
+// pickWeighted returns the next upstream using a deterministic weighted
+// round-robin cursor (no randomness, so behaviour is reproducible).
+func (m *MultiResolver) pickWeighted() *Upstream {
+	total := 0
+	for _, up := range m.upstreams {
+		total += up.Weight
+	}
+
+	n := int(atomic.AddUint64(&m.rrCounter, 1)-1) % total
+	for _, up := range m.upstreams {
+		if n < up.Weight {
+			return up
+		}
+		n -= up.Weight
+	}
+	return m.upstreams[len(m.upstreams)-1]
+}
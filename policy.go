@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// PolicyAction is what a matched policy rule does with a query.
+type PolicyAction int
+
+const (
+	// ActionNXDOMAIN synthesizes an NXDOMAIN response.
+	ActionNXDOMAIN PolicyAction = iota
+	// ActionNODATA synthesizes a success response with an empty answer
+	// section.
+	ActionNODATA
+	// ActionSinkhole synthesizes 0.0.0.0/:: for A/AAAA queries (NODATA
+	// for anything else).
+	ActionSinkhole
+)
+
+// PolicyTTL is the TTL of the sinkhole A/AAAA records in a synthesized
+// policy response, and the lifetime resolveWithCache reports for every
+// policy response. Kept short so a rule change (or reload) takes effect
+// quickly. NXDOMAIN and NODATA responses carry no SOA record, so no TTL
+// appears in them.
+const PolicyTTL = 60
+
+// PolicyRule is a single compiled blocklist entry.
+type PolicyRule struct {
+	Source string
+	Action PolicyAction
+}
+
+// PolicySource is one list to load into a PolicyEngine.
+type PolicySource struct {
+	Path   string
+	Format string // "hosts", "adblock", or "regex"
+	Action PolicyAction
+}
+
+// PolicyConfig is the full set of sources a PolicyEngine loads (and
+// reloads) its rules from.
+type PolicyConfig struct {
+	Sources []PolicySource
+}
+
+type compiledRegexRule struct {
+	source string
+	re     *regexp.Regexp
+	action PolicyAction
+}
+
+// PolicyEngine blocks, rewrites, or forces NXDOMAIN for queries matching
+// rules loaded from hosts-file, adblock-style, or regex sources, before
+// they ever reach the cache or an upstream resolver. Matching is a
+// reverse-domain trie lookup (suffix match), whose cost is independent of
+// list size, with a compiled-regex fallback that tries each regex rule in
+// turn.
+type PolicyEngine struct {
+	mu      sync.RWMutex
+	suffix  *suffixTrie
+	regexes []*compiledRegexRule
+	sources []PolicySource // remembered for Reload
+
+	blocked sync.Map // rule source -> *uint64 block counter
+}
+
+// NewPolicyEngine returns an empty PolicyEngine that blocks nothing until
+// LoadConfig is called.
+func NewPolicyEngine() *PolicyEngine {
+	return &PolicyEngine{suffix: newSuffixTrie()}
+}
+
+// LoadConfig (re)loads every source in cfg into a fresh rule set and
+// atomically swaps it in, so a bad reload never leaves the engine with a
+// half-applied rule set.
+func (p *PolicyEngine) LoadConfig(cfg PolicyConfig) error {
+	fresh := NewPolicyEngine()
+
+	for _, src := range cfg.Sources {
+		var err error
+		switch src.Format {
+		case "hosts":
+			err = fresh.loadHostsFile(src.Path, src.Action)
+		case "adblock":
+			err = fresh.loadAdblockList(src.Path, src.Action)
+		case "regex":
+			err = fresh.loadRegexList(src.Path, src.Action)
+		default:
+			err = fmt.Errorf("policy: unknown source format %q for %s", src.Format, src.Path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.suffix = fresh.suffix
+	p.regexes = fresh.regexes
+	p.sources = cfg.Sources
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Reload re-reads every configured source from disk. Intended to be wired
+// up to SIGHUP or an admin HTTP endpoint so lists can be refreshed
+// without restarting the process.
+func (p *PolicyEngine) Reload() error {
+	p.mu.RLock()
+	sources := p.sources
+	p.mu.RUnlock()
+	return p.LoadConfig(PolicyConfig{Sources: sources})
+}
+
+// loadHostsFile loads rules from a plain hosts-file (IP domain [domain...])
+// formatted list, e.g. "0.0.0.0 ads.example.com". Loopback targets are
+// skipped since those are typically the file's own self-aliasing, not a
+// blocklist signal.
+func (p *PolicyEngine) loadHostsFile(path string, action PolicyAction) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("policy: open hosts file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	source := "hosts:" + path
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if strings.HasPrefix(domain, "#") {
+				break
+			}
+			p.suffix.add(domain, &PolicyRule{Source: source, Action: action})
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("policy: read hosts file %s: %w", path, err)
+	}
+
+	log.Printf("policy: loaded %d rules from %s", count, source)
+	return nil
+}
+
+// loadAdblockList loads one adblock-style domain rule per line, e.g.
+// "||example.com^". Lines that aren't a plain domain-block rule
+// (exceptions, cosmetic rules, comments) are skipped rather than
+// misinterpreted.
+func (p *PolicyEngine) loadAdblockList(path string, action PolicyAction) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("policy: open adblock list %s: %w", path, err)
+	}
+	defer f.Close()
+
+	source := "adblock:" + path
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "@@") {
+			continue
+		}
+		if !strings.HasPrefix(line, "||") {
+			continue
+		}
+		domain := strings.TrimSuffix(strings.TrimPrefix(line, "||"), "^")
+		if domain == "" || strings.ContainsAny(domain, "/*$") {
+			continue
+		}
+		p.suffix.add(domain, &PolicyRule{Source: source, Action: action})
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("policy: read adblock list %s: %w", path, err)
+	}
+
+	log.Printf("policy: loaded %d rules from %s", count, source)
+	return nil
+}
+
+// loadRegexList loads one Go-syntax regular expression per line, matched
+// against the full query name as a fallback after the suffix trie misses.
+func (p *PolicyEngine) loadRegexList(path string, action PolicyAction) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("policy: open regex list %s: %w", path, err)
+	}
+	defer f.Close()
+
+	source := "regex:" + path
+	var rules []*compiledRegexRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			log.Printf("policy: skipping invalid regex %q in %s: %v", line, path, err)
+			continue
+		}
+		rules = append(rules, &compiledRegexRule{source: source, re: re, action: action})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("policy: read regex list %s: %w", path, err)
+	}
+
+	p.regexes = append(p.regexes, rules...)
+	log.Printf("policy: loaded %d rules from %s", len(rules), source)
+	return nil
+}
+
+// Match returns the policy rule for qname, if any.
+func (p *PolicyEngine) Match(qname string) *PolicyRule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if rule := p.suffix.match(qname); rule != nil {
+		return rule
+	}
+	for _, rr := range p.regexes {
+		if rr.re.MatchString(qname) {
+			return &PolicyRule{Source: rr.source, Action: rr.action}
+		}
+	}
+	return nil
+}
+
+// Apply synthesizes a response for r if a policy rule matches its
+// question, recording the block against that rule's source for metrics.
+// ok is false if no rule matched, meaning the query should proceed to the
+// cache/resolver as normal.
+func (p *PolicyEngine) Apply(r *dns.Msg) (resp *dns.Msg, ok bool) {
+	if len(r.Question) == 0 {
+		return nil, false
+	}
+	q := r.Question[0]
+
+	rule := p.Match(q.Name)
+	if rule == nil {
+		return nil, false
+	}
+	p.recordBlock(rule.Source)
+
+	resp = new(dns.Msg)
+	resp.SetReply(r)
+
+	switch rule.Action {
+	case ActionNXDOMAIN:
+		resp.Rcode = dns.RcodeNameError
+	case ActionSinkhole:
+		resp.Rcode = dns.RcodeSuccess
+		switch q.Qtype {
+		case dns.TypeA:
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: PolicyTTL},
+				A:   net.IPv4zero,
+			})
+		case dns.TypeAAAA:
+			resp.Answer = append(resp.Answer, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: PolicyTTL},
+				AAAA: net.IPv6zero,
+			})
+		default:
+			resp.Rcode = dns.RcodeSuccess // NODATA: nothing sensible to sinkhole
+		}
+	default: // ActionNODATA
+		resp.Rcode = dns.RcodeSuccess
+	}
+
+	return resp, true
+}
+
+func (p *PolicyEngine) recordBlock(source string) {
+	v, _ := p.blocked.LoadOrStore(source, new(uint64))
+	atomic.AddUint64(v.(*uint64), 1)
+	policyBlocksTotal.WithLabelValues(source).Inc()
+}
+
+// BlockCounts returns a snapshot of blocks-per-rule-source counters.
+func (p *PolicyEngine) BlockCounts() map[string]uint64 {
+	out := make(map[string]uint64)
+	p.blocked.Range(func(k, v any) bool {
+		out[k.(string)] = atomic.LoadUint64(v.(*uint64))
+		return true
+	})
+	return out
+}
+
+// trieNode is one label of a suffixTrie.
+type trieNode struct {
+	children map[string]*trieNode
+	rule     *PolicyRule // non-nil if this node is itself a terminal rule
+}
+
+// suffixTrie indexes domains by label, from TLD down to subdomain, so
+// "example.com" also matches "sub.example.com" (like adblock's `||`
+// anchor) without scanning every rule per query.
+type suffixTrie struct {
+	root *trieNode
+}
+
+func newSuffixTrie() *suffixTrie {
+	return &suffixTrie{root: &trieNode{children: make(map[string]*trieNode)}}
+}
+
+func (t *suffixTrie) add(domain string, rule *PolicyRule) {
+	labels := reverseLabels(domain)
+	if len(labels) == 0 {
+		return
+	}
+
+	node := t.root
+	for _, label := range labels {
+		child, ok := node.children[label]
+		if !ok {
+			child = &trieNode{children: make(map[string]*trieNode)}
+			node.children[label] = child
+		}
+		node = child
+	}
+	node.rule = rule
+}
+
+// match returns the rule for the longest matching suffix of qname.
+func (t *suffixTrie) match(qname string) *PolicyRule {
+	var matched *PolicyRule
+	node := t.root
+	for _, label := range reverseLabels(qname) {
+		child, ok := node.children[label]
+		if !ok {
+			break
+		}
+		node = child
+		if node.rule != nil {
+			matched = node.rule
+		}
+	}
+	return matched
+}
+
+// reverseLabels splits domain into its dot-separated labels, lowercased,
+// in TLD-first order.
+func reverseLabels(domain string) []string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if domain == "" {
+		return nil
+	}
+	labels := strings.Split(domain, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache is a Cache backend that stores packed DNS responses in Redis,
+// so multiple mine-dns instances behind a load balancer can share a warm
+// cache. TTLs are enforced server-side via Redis EXPIRE rather than an
+// expiry check on read.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache builds a RedisCache from cfg. cfg.RedisURL is used if set,
+// falling back to the REDIS_URL environment variable.
+func NewRedisCache(cfg CacheConfig) (*RedisCache, error) {
+	url := cfg.RedisURL
+	if url == "" {
+		url = os.Getenv("REDIS_URL")
+	}
+	if url == "" {
+		return nil, errors.New("redis cache: no RedisURL configured (set CacheConfig.RedisURL or REDIS_URL)")
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("redis cache: parse redis url: %w", err)
+	}
+
+	prefix := cfg.RedisKeyPrefix
+	if prefix == "" {
+		prefix = DefaultCacheConfig.RedisKeyPrefix
+	}
+
+	return &RedisCache{
+		client: redis.NewClient(opts),
+		prefix: prefix,
+	}, nil
+}
+
+func (c *RedisCache) Get(key string) (*dns.Msg, bool) {
+	ctx := context.Background()
+	fullKey := c.prefix + key
+
+	raw, err := c.client.Get(ctx, fullKey).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("redis cache: get %s: %v", key, err)
+		}
+		return nil, false
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(raw); err != nil {
+		log.Printf("redis cache: unpack %s: %v", key, err)
+		return nil, false
+	}
+
+	// Redis enforces expiry server-side via the EXPIRE set alongside the
+	// entry, so its remaining TTL on the key *is* the entry's remaining
+	// lifetime; reuse it instead of replaying the TTL it was packed
+	// with, same as MemoryCache.Get does from its own storedAt.
+	remaining, err := c.client.TTL(ctx, fullKey).Result()
+	if err != nil {
+		log.Printf("redis cache: ttl %s: %v", key, err)
+		return nil, false
+	}
+	if remaining <= 0 {
+		return nil, false
+	}
+	applyTTL(msg, uint32(remaining.Seconds()))
+
+	return msg, true
+}
+
+func (c *RedisCache) Set(key string, msg *dns.Msg, ttl time.Duration) {
+	if ttl <= 0 {
+		// go-redis treats a zero expiration as "no expiration" (SET
+		// without EX), which would leave a zero-TTL answer (e.g. an
+		// uncacheable record or a negative answer with SOA MINIMUM=0)
+		// in Redis forever instead of evicting it. Skip the write
+		// rather than caching something that's already stale.
+		return
+	}
+
+	raw, err := msg.Pack()
+	if err != nil {
+		log.Printf("redis cache: pack %s: %v", key, err)
+		return
+	}
+
+	if err := c.client.Set(context.Background(), c.prefix+key, raw, ttl).Err(); err != nil {
+		log.Printf("redis cache: set %s: %v", key, err)
+	}
+}
+
+func (c *RedisCache) Delete(key string) {
+	if err := c.client.Del(context.Background(), c.prefix+key).Err(); err != nil {
+		log.Printf("redis cache: delete %s: %v", key, err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/proxy"
+)
+
+// Resolver resolves a single DNS query against some upstream server.
+// Implementations must be safe for concurrent use.
+type Resolver interface {
+	Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+	String() string
+}
+
+// dialFunc is shared by every resolver implementation so each upstream can
+// be routed through its own SOCKS5 proxy (or dial directly).
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// directDialer dials the network directly, bypassing any proxy.
+func directDialer(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{}
+	return d.DialContext(ctx, network, addr)
+}
+
+// socks5Dialer builds a dialFunc that routes connections through the given
+// SOCKS5 proxy address.
+func socks5Dialer(socksAddr string) (dialFunc, error) {
+	dialer, err := proxy.SOCKS5("tcp", socksAddr, nil, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("build socks5 dialer for %s: %w", socksAddr, err)
+	}
+	ctxDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("socks5 dialer for %s does not support DialContext", socksAddr)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return ctxDialer.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// DoHGetResolver resolves queries via DNS-over-HTTPS using the GET method
+// (RFC 8484 ?dns=<base64url>).
+type DoHGetResolver struct {
+	URL    string
+	Dial   dialFunc
+	Client *http.Client
+}
+
+// NewDoHGetResolver builds a GET-style DoH resolver. If dial is nil, the
+// resolver dials upstreams directly.
+func NewDoHGetResolver(url string, dial dialFunc) *DoHGetResolver {
+	if dial == nil {
+		dial = directDialer
+	}
+	return &DoHGetResolver{
+		URL:  url,
+		Dial: dial,
+		Client: &http.Client{
+			Transport: &http.Transport{DialContext: dial},
+			Timeout:   10 * time.Second,
+		},
+	}
+}
+
+func (r *DoHGetResolver) String() string { return "doh-get:" + r.URL }
+
+func (r *DoHGetResolver) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	raw, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("pack query: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", r.URL+"?dns="+encoded, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	return doHTTP(r.Client, req)
+}
+
+// DoHPostResolver resolves queries via DNS-over-HTTPS using the POST method
+// with a raw application/dns-message body (RFC 8484).
+type DoHPostResolver struct {
+	URL    string
+	Dial   dialFunc
+	Client *http.Client
+}
+
+// NewDoHPostResolver builds a POST-style DoH resolver. If dial is nil, the
+// resolver dials upstreams directly.
+func NewDoHPostResolver(url string, dial dialFunc) *DoHPostResolver {
+	if dial == nil {
+		dial = directDialer
+	}
+	return &DoHPostResolver{
+		URL:  url,
+		Dial: dial,
+		Client: &http.Client{
+			Transport: &http.Transport{DialContext: dial},
+			Timeout:   10 * time.Second,
+		},
+	}
+}
+
+func (r *DoHPostResolver) String() string { return "doh-post:" + r.URL }
+
+func (r *DoHPostResolver) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	raw, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("pack query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.URL, bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	return doHTTP(r.Client, req)
+}
+
+func doHTTP(client *http.Client, req *http.Request) (*dns.Msg, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("doh request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh upstream returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read doh response: %w", err)
+	}
+
+	dnsResp := new(dns.Msg)
+	if err := dnsResp.Unpack(body); err != nil {
+		return nil, fmt.Errorf("unpack doh response: %w", err)
+	}
+
+	return dnsResp, nil
+}
+
+// DoTResolver resolves queries via DNS-over-TLS.
+type DoTResolver struct {
+	Addr       string
+	ServerName string
+	Dial       dialFunc
+	Timeout    time.Duration
+}
+
+// NewDoTResolver builds a DoT resolver for addr (host:port). If dial is nil,
+// the resolver dials upstreams directly.
+func NewDoTResolver(addr, serverName string, dial dialFunc) *DoTResolver {
+	if dial == nil {
+		dial = directDialer
+	}
+	return &DoTResolver{
+		Addr:       addr,
+		ServerName: serverName,
+		Dial:       dial,
+		Timeout:    5 * time.Second,
+	}
+}
+
+func (r *DoTResolver) String() string { return "dot:" + r.Addr }
+
+func (r *DoTResolver) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	conn, err := r.Dial(ctx, "tcp", r.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", r.Addr, err)
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: r.ServerName})
+	dnsConn := &dns.Conn{Conn: tlsConn}
+	defer dnsConn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		dnsConn.SetDeadline(deadline)
+	} else {
+		dnsConn.SetDeadline(time.Now().Add(r.Timeout))
+	}
+
+	if err := dnsConn.WriteMsg(query); err != nil {
+		return nil, fmt.Errorf("write query to %s: %w", r.Addr, err)
+	}
+
+	resp, err := dnsConn.ReadMsg()
+	if err != nil {
+		return nil, fmt.Errorf("read response from %s: %w", r.Addr, err)
+	}
+
+	return resp, nil
+}
+
+// PlainResolver resolves queries via classic UDP (falling back to TCP on
+// truncation) or TCP-only, against a plain DNS server.
+type PlainResolver struct {
+	Addr    string
+	Net     string // "udp" or "tcp"
+	Dial    dialFunc
+	Timeout time.Duration
+}
+
+// NewPlainResolver builds a plain UDP/TCP resolver for addr (host:port). If
+// dial is nil, the resolver dials upstreams directly.
+func NewPlainResolver(addr, network string, dial dialFunc) *PlainResolver {
+	if dial == nil {
+		dial = directDialer
+	}
+	if network == "" {
+		network = "udp"
+	}
+	return &PlainResolver{
+		Addr:    addr,
+		Net:     network,
+		Dial:    dial,
+		Timeout: 5 * time.Second,
+	}
+}
+
+func (r *PlainResolver) String() string { return r.Net + ":" + r.Addr }
+
+func (r *PlainResolver) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	conn, err := r.Dial(ctx, r.Net, r.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", r.Addr, err)
+	}
+
+	dnsConn := &dns.Conn{Conn: conn}
+	defer dnsConn.Close()
+	// Size the UDP receive buffer to the buffer size the query advertises;
+	// otherwise replies are read into a 512-byte buffer.
+	if opt := query.IsEdns0(); opt != nil {
+		dnsConn.UDPSize = opt.UDPSize()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		dnsConn.SetDeadline(deadline)
+	} else {
+		dnsConn.SetDeadline(time.Now().Add(r.Timeout))
+	}
+
+	if err := dnsConn.WriteMsg(query); err != nil {
+		return nil, fmt.Errorf("write query to %s: %w", r.Addr, err)
+	}
+
+	resp, err := dnsConn.ReadMsg()
+	if err != nil {
+		return nil, fmt.Errorf("read response from %s: %w", r.Addr, err)
+	}
+
+	if resp.Truncated && r.Net == "udp" {
+		tcp := &PlainResolver{Addr: r.Addr, Net: "tcp", Dial: r.Dial, Timeout: r.Timeout}
+		return tcp.Resolve(ctx, query)
+	}
+
+	return resp, nil
+}